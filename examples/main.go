@@ -7,6 +7,7 @@ import (
 	"log"
 	"net/url"
 	"os"
+	"strings"
 	"syscall"
 
 	httpproxy "github.com/fopina/net-proxy-httpconnect/proxy"
@@ -21,8 +22,22 @@ func init() {
 	httpproxy.RegisterSchemes()
 }
 
+// proxyList collects repeated -proxy flags, in order, to build a CONNECT
+// proxy chain (mirroring dumbproxy's -proxy flag).
+type proxyList []string
+
+func (p *proxyList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *proxyList) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
 func main() {
-	proxyPtr := flag.String("proxy", "", "proxy URL")
+	var proxyPtr proxyList
+	flag.Var(&proxyPtr, "proxy", "proxy URL, scheme http/https/socks5/socks5h/ssh (repeat to chain through multiple http/https proxies, in order)")
 	envPtr := flag.Bool("env", false, "use settings configuration from environment")
 
 	flag.Usage = func() {
@@ -53,14 +68,28 @@ func main() {
 
 	var dialer proxy.Dialer
 
-	if *proxyPtr != "" {
-		proxyURL, err := url.Parse(*proxyPtr)
+	if len(proxyPtr) == 1 {
+		proxyURL, err := url.Parse(proxyPtr[0])
 		if err != nil {
 			log.Fatal("invalid proxy URL", err)
 		}
-		dialer, err = httpproxy.HTTPCONNECT(proxyURL, nil)
+		dialer, err = httpproxy.NewFromURL(proxyURL, nil)
+		if err != nil {
+			log.Fatalf("failed to dial proxy: %v", err)
+		}
+	} else if len(proxyPtr) > 1 {
+		proxyURLs := make([]*url.URL, len(proxyPtr))
+		for i, p := range proxyPtr {
+			proxyURL, err := url.Parse(p)
+			if err != nil {
+				log.Fatal("invalid proxy URL", err)
+			}
+			proxyURLs[i] = proxyURL
+		}
+		var err error
+		dialer, err = httpproxy.HTTPCONNECTChain(proxyURLs, nil)
 		if err != nil {
-			log.Fatalf("failed to dial http proxy: %v", err)
+			log.Fatalf("failed to dial proxy chain: %v", err)
 		}
 	} else if *envPtr {
 		dialer = proxy.FromEnvironment()
@@ -0,0 +1,103 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpconnect
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// A ChainDialer tunnels a connection through a sequence of HTTP CONNECT
+// proxies, dialing hop 0, then issuing a CONNECT to hop 1 over hop 0's
+// connection, and so on until the final hop CONNECTs to the destination
+// address.
+type ChainDialer struct {
+	proxyNetwork string          // network between a proxy server and a client
+	proxyUrls    []*url.URL      // proxy server urls, in dialing order
+	transport    *http.Transport // transport used to dial the first hop
+}
+
+// NewChainDialer returns a new ChainDialer that tunnels through urls in
+// order before reaching the final destination. The provided transport is
+// used to dial the first hop; each subsequent hop gets its own transport
+// wired to dial through the previous hop's connection, so per-hop
+// Proxy-Authorization headers never leak between hops.
+func NewChainDialer(network string, urls []*url.URL, transport *http.Transport) (*ChainDialer, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("httpconnect: ChainDialer requires at least one proxy URL")
+	}
+	for _, u := range urls {
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, errors.New("httpconnect: unsupported proxy scheme: " + u.Scheme)
+		}
+	}
+	return &ChainDialer{
+		proxyNetwork: network,
+		proxyUrls:    urls,
+		transport:    transport,
+	}, nil
+}
+
+// DialContext connects to address on network, tunnelling through every hop
+// configured on the ChainDialer, in order. If ctx is cancelled before the
+// chain is fully established, every hop dialed so far is closed.
+func (c *ChainDialer) DialContext(ctx context.Context, network, address string) (conn *dialerConn, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	hops := make([]*dialerConn, 0, len(c.proxyUrls))
+	teardown := func() {
+		for i := len(hops) - 1; i >= 0; i-- {
+			hops[i].Close()
+		}
+	}
+
+	transport := c.transport
+	for i, u := range c.proxyUrls {
+		if err = ctx.Err(); err != nil {
+			teardown()
+			return nil, err
+		}
+
+		d := NewDialer(c.proxyNetwork, u, transport)
+		if d == nil {
+			teardown()
+			return nil, errors.New("httpconnect: unsupported proxy scheme: " + u.Scheme)
+		}
+
+		hopAddress := address
+		if i < len(c.proxyUrls)-1 {
+			hopAddress = c.proxyUrls[i+1].Host
+		}
+
+		hop, herr := d.DialContext(ctx, network, hopAddress)
+		if herr != nil {
+			teardown()
+			return nil, herr
+		}
+		hops = append(hops, hop)
+
+		// Subsequent hops tunnel over the connection just established,
+		// each with its own transport so per-hop auth headers stay isolated.
+		transport = &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return hop, nil
+			},
+		}
+	}
+
+	return hops[len(hops)-1], nil
+}
+
+// Dial connects to the provided address on the provided network.
+//
+// Deprecated: Use DialContext instead.
+func (c *ChainDialer) Dial(network, address string) (net.Conn, error) {
+	return c.DialContext(context.Background(), network, address)
+}
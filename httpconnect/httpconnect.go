@@ -10,7 +10,6 @@ package httpconnect
 
 import (
 	"context"
-	"encoding/base64"
 	"errors"
 	"io"
 	"net"
@@ -79,9 +78,14 @@ func isClosedChan(c <-chan struct{}) bool {
 	}
 }
 
+// readBufferSize is the size of the buffer the background reader goroutine
+// reads into, matching the chunk size io.Copy uses by default.
+const readBufferSize = 32 * 1024
+
+// ioResult is a completed read: either undelivered bytes, a terminal error,
+// or both (an error is only surfaced to the caller once b is exhausted).
 type ioResult struct {
 	b   []byte
-	n   int
 	err error
 }
 
@@ -100,23 +104,79 @@ var (
 )
 
 func newDialerConn() *dialerConn {
-	return &dialerConn{
+	c := &dialerConn{
 		done:         make(chan struct{}),
 		readDeadline: deadline{cancel: make(chan struct{})},
+		readerReady:  make(chan struct{}),
+		reads:        make(chan ioResult),
 	}
+	go c.readLoop()
+	return c
 }
 
 type dialerConn struct {
-	w              net.Conn
-	r              io.ReadCloser
-	localAddr      net.Addr
-	remoteAddr     net.Addr
-	readDeadline   deadline
-	readMu         sync.Mutex
-	once           sync.Once // protects closing done
-	done           chan struct{}
-	storedRead     *ioResult
-	readInProgress bool
+	w            net.Conn
+	localAddr    net.Addr
+	remoteAddr   net.Addr
+	readDeadline deadline
+	readMu       sync.Mutex // serializes Read and guards pending
+	once         sync.Once  // protects closing done
+	done         chan struct{}
+
+	rMu         sync.Mutex // guards r
+	r           io.ReadCloser
+	readerReady chan struct{} // closed once r has been assigned via setReader
+	reads       chan ioResult // results produced by readLoop
+	pending     *ioResult     // bytes read ahead of what Read has returned to the caller
+
+	// rawConn is the net.Conn the proxy transport dialed, captured via
+	// httptrace.GotConnInfo. The connect-udp path (see DialPacketContext)
+	// writes to it directly once upgraded, since it has no net.Pipe body to
+	// write through the way the CONNECT path does.
+	rawConn net.Conn
+}
+
+// setReader hands the long-lived reader goroutine its source once the
+// tunnel has been established; it must be called at most once.
+func (c *dialerConn) setReader(r io.ReadCloser) {
+	c.rMu.Lock()
+	c.r = r
+	c.rMu.Unlock()
+	close(c.readerReady)
+}
+
+// readLoop owns c.r for the lifetime of the connection: it blocks until a
+// reader is handed off by setReader, then issues reads against it and
+// publishes each result on c.reads, exiting on the first error or once done
+// is closed. Running this as a single goroutine (rather than spawning one
+// per Read call) removes the busy-wait and data race the previous
+// implementation had on a shared "last read" field.
+func (c *dialerConn) readLoop() {
+	select {
+	case <-c.readerReady:
+	case <-c.done:
+		return
+	}
+
+	c.rMu.Lock()
+	r := c.r
+	c.rMu.Unlock()
+
+	for {
+		buf := make([]byte, readBufferSize)
+		n, err := r.Read(buf)
+		if n == 0 && err == nil {
+			err = io.EOF
+		}
+		select {
+		case c.reads <- ioResult{b: buf[:n], err: err}:
+		case <-c.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
 }
 
 func (c *dialerConn) Write(b []byte) (n int, err error) {
@@ -125,6 +185,24 @@ func (c *dialerConn) Write(b []byte) (n int, err error) {
 }
 
 func (c *dialerConn) Read(b []byte) (n int, err error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	// Drain bytes handed off by a previous call before touching the
+	// channel again: a single readLoop result can be larger than the
+	// caller's buffer. A result that is ready just as a deadline fires is
+	// not lost either way: readLoop keeps it until a later Read receives it.
+	if c.pending != nil {
+		res := c.pending
+		n = copy(b, res.b)
+		if n < len(res.b) {
+			c.pending = &ioResult{b: res.b[n:], err: res.err}
+			return n, nil
+		}
+		c.pending = nil
+		return n, res.err
+	}
+
 	switch {
 	case isClosedChan(c.done):
 		return 0, errClosed
@@ -132,47 +210,33 @@ func (c *dialerConn) Read(b []byte) (n int, err error) {
 		return 0, errDeadline
 	}
 
-	// Ensure there aren't multiple reads depending on a previous read that
-	// hasn't yet returned
-	c.readMu.Lock()
-	defer c.readMu.Unlock()
-	ioCh := make(chan *ioResult)
-	go func(ch chan *ioResult) {
-		if c.readInProgress {
-			for {
-				if c.storedRead != nil {
-					ch <- c.storedRead
-					return
-				}
-			}
-		} else {
-			c.readInProgress = true
-			n, err := c.r.Read(b)
-			if n == 0 {
-				err = io.EOF
-			}
-			c.storedRead = &ioResult{b[:n], n, err}
-			ch <- c.storedRead
-		}
-	}(ioCh)
-
 	select {
 	case <-c.done:
 		return 0, errClosed
 	case <-c.readDeadline.wait():
 		return 0, errDeadline
-	case read := <-ioCh:
-		// clear the stored read
-		c.storedRead = nil
-		c.readInProgress = false
-		copy(b[:read.n], read.b[:read.n])
-		return read.n, read.err
+	case res := <-c.reads:
+		n = copy(b, res.b)
+		if n < len(res.b) {
+			c.pending = &ioResult{b: res.b[n:], err: res.err}
+			return n, nil
+		}
+		return n, res.err
 	}
 }
 
 func (c *dialerConn) Close() error {
-	c.w.Close()                         // close writer
-	c.once.Do(func() { close(c.done) }) // close reader
+	c.w.Close() // close writer
+	c.once.Do(func() {
+		close(c.done) // unblock readLoop and any Read waiting on it
+
+		c.rMu.Lock()
+		r := c.r
+		c.rMu.Unlock()
+		if r != nil {
+			r.Close() // unblock a read already in flight against r
+		}
+	})
 	return nil
 }
 
@@ -204,6 +268,7 @@ func (c *dialerConn) addrTrackingGotConn() func(connInfo httptrace.GotConnInfo)
 	return func(connInfo httptrace.GotConnInfo) {
 		c.localAddr = connInfo.Conn.LocalAddr()
 		c.remoteAddr = connInfo.Conn.RemoteAddr()
+		c.rawConn = connInfo.Conn
 	}
 }
 
@@ -212,6 +277,64 @@ type Dialer struct {
 	proxyNetwork   string   // network between a proxy server and a client
 	proxyUrl       *url.URL // proxy server url
 	proxyTransport *http.Transport
+
+	// AuthHandler, if set, is consulted whenever a CONNECT is answered
+	// with 407 Proxy Authentication Required: it computes the
+	// Proxy-Authorization header for a single retry of the CONNECT.
+	AuthHandler AuthHandler
+}
+
+// connect issues a single CONNECT request for address, setting an extra
+// Proxy-Authorization header when authHeader is non-empty. It returns the
+// request (for AuthHandler.Challenge to inspect) and the raw response.
+func (d *Dialer) connect(ctx context.Context, conn *dialerConn, address, authHeader string) (*http.Request, *http.Response, error) {
+	pr, pw := net.Pipe()
+
+	header := d.proxyTransport.ProxyConnectHeader.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	if authHeader != "" {
+		header.Set("Proxy-Authorization", authHeader)
+	}
+
+	connectReq := &http.Request{
+		Method: "CONNECT",
+		URL:    d.proxyUrl,
+		Host:   address,
+		Header: header,
+		Body:   pr,
+	}
+	trace := &httptrace.ClientTrace{
+		GotConn: conn.addrTrackingGotConn(),
+	}
+	connectReq = connectReq.WithContext(httptrace.WithClientTrace(ctx, trace))
+
+	// RoundTrip's write loop reads pr for as long as the tunnel lives (it's
+	// how bytes written to pw later reach the proxy), so a hung proxy that
+	// accepts the TCP connection but never answers the CONNECT leaves that
+	// read blocked independently of ctx: cancelling ctx alone closes the
+	// transport's connection to the proxy, but RoundTrip then waits on its
+	// write loop to finish, which won't happen until the read from pr
+	// itself returns. Close pr on ctx cancellation to unblock it; stop
+	// watching once RoundTrip has returned, since pr is then the live
+	// write side of an established tunnel (conn.w = pw below).
+	watchDone := make(chan struct{})
+	defer close(watchDone)
+	go func() {
+		select {
+		case <-ctx.Done():
+			pr.Close()
+		case <-watchDone:
+		}
+	}()
+
+	resp, err := d.proxyTransport.RoundTrip(connectReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.w = pw
+	return connectReq, resp, nil
 }
 
 // DialContext connects to the provided address on the provided network.
@@ -230,39 +353,35 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (conn
 	}
 
 	conn = newDialerConn()
-	pr, pw := net.Pipe()
 
-	if d.proxyTransport.ProxyConnectHeader == nil {
-		d.proxyTransport.ProxyConnectHeader = make(http.Header)
+	req, resp, err := d.connect(ctx, conn, address, "")
+	if err != nil {
+		return nil, err
 	}
 
-	connectReq := &http.Request{
-		Method: "CONNECT",
-		URL:    d.proxyUrl,
-		Host:   address,
-		Header: d.proxyTransport.ProxyConnectHeader,
-		Body:   pr,
-	}
-	trace := &httptrace.ClientTrace{
-		GotConn: conn.addrTrackingGotConn(),
-	}
-	connectReq = connectReq.WithContext(httptrace.WithClientTrace(ctx, trace))
-	resp, err := d.proxyTransport.RoundTrip(connectReq)
-	if err != nil {
-		return
+	if resp.StatusCode == http.StatusProxyAuthRequired && d.AuthHandler != nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		authHeader, herr := d.AuthHandler.Challenge(resp, req)
+		if herr != nil {
+			return nil, herr
+		}
+
+		if req, resp, err = d.connect(ctx, conn, address, authHeader); err != nil {
+			return nil, err
+		}
 	}
+
 	if resp.StatusCode != 200 {
 		f := strings.SplitN(resp.Status, " ", 2)
 		if len(f) < 2 {
-			err = errors.New("unknown status code")
-			return
+			return nil, errors.New("unknown status code")
 		}
-		err = errors.New(f[1])
-		return
+		return nil, errors.New(f[1])
 	}
-	conn.w = pw
-	conn.r = resp.Body
-	return
+	conn.setReader(resp.Body)
+	return conn, nil
 }
 
 // Dial connects to the provided address on the provided network.
@@ -279,18 +398,24 @@ func NewDialer(network string, url *url.URL, transport *http.Transport) *Dialer
 	if url.Scheme != "http" && url.Scheme != "https" {
 		return nil
 	}
-	// Copy the credentials for the proxy to the Transport
+	d := &Dialer{
+		proxyNetwork:   network,
+		proxyUrl:       url,
+		proxyTransport: transport,
+	}
+	// Copy the credentials for the proxy to the Transport, and keep the
+	// same BasicAuth around as the AuthHandler in case the proxy still
+	// challenges the proactive header with a 407.
 	if url.User != nil {
+		password, _ := url.User.Password()
+		basic := &BasicAuth{Username: url.User.Username(), Password: password}
+		d.AuthHandler = basic
+
 		if transport.ProxyConnectHeader == nil {
 			transport.ProxyConnectHeader = make(http.Header)
 		}
-		password, _ := url.User.Password()
-		encodedAuth := base64.StdEncoding.EncodeToString([]byte(url.User.Username() + ":" + password))
-		transport.ProxyConnectHeader.Set("Proxy-Authorization", "Basic "+encodedAuth)
-	}
-	return &Dialer{
-		proxyNetwork:   network,
-		proxyUrl:       url,
-		proxyTransport: transport,
+		header, _ := basic.Challenge(nil, nil)
+		transport.ProxyConnectHeader.Set("Proxy-Authorization", header)
 	}
+	return d
 }
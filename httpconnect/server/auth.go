@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Authenticator validates the Proxy-Authorization header of a CONNECT
+// request.
+type Authenticator interface {
+	// Authenticate reports whether r carries valid proxy credentials.
+	Authenticate(r *http.Request) bool
+	// Challenge returns the value to set on the Proxy-Authenticate header
+	// of a 407 response.
+	Challenge() string
+}
+
+// NoAuth is an Authenticator that allows every request.
+type NoAuth struct{}
+
+// Authenticate always returns true.
+func (NoAuth) Authenticate(*http.Request) bool { return true }
+
+// Challenge returns the empty string; it is never used since Authenticate
+// never fails.
+func (NoAuth) Challenge() string { return "" }
+
+// BasicAuth authenticates requests against an htpasswd-style file of
+// "user:bcryptHash" lines (as produced by `htpasswd -B`).
+type BasicAuth struct {
+	Realm string
+
+	mu     sync.RWMutex
+	hashes map[string][]byte
+}
+
+// NewBasicAuth reads an htpasswd file containing bcrypt password hashes and
+// returns a BasicAuth that authenticates against it.
+func NewBasicAuth(realm, htpasswdPath string) (*BasicAuth, error) {
+	f, err := os.Open(htpasswdPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hashes := make(map[string][]byte)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("httpconnect/server: malformed htpasswd line: %q", line)
+		}
+		hashes[user] = []byte(hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &BasicAuth{Realm: realm, hashes: hashes}, nil
+}
+
+// Authenticate checks the Proxy-Authorization header against the loaded
+// htpasswd entries.
+func (b *BasicAuth) Authenticate(r *http.Request) bool {
+	user, pass, ok := parseProxyBasicAuth(r)
+	if !ok {
+		return false
+	}
+
+	b.mu.RLock()
+	hash, ok := b.hashes[user]
+	b.mu.RUnlock()
+	if !ok {
+		return false
+	}
+
+	return bcrypt.CompareHashAndPassword(hash, []byte(pass)) == nil
+}
+
+// Challenge returns the Basic challenge for this realm.
+func (b *BasicAuth) Challenge() string {
+	return fmt.Sprintf("Basic realm=%q", b.Realm)
+}
+
+func parseProxyBasicAuth(r *http.Request) (user, pass string, ok bool) {
+	auth := r.Header.Get("Proxy-Authorization")
+	const prefix = "Basic "
+	if !strings.HasPrefix(auth, prefix) {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(auth[len(prefix):])
+	if err != nil {
+		return "", "", false
+	}
+	user, pass, ok = strings.Cut(string(decoded), ":")
+	return user, pass, ok
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// writeHtpasswd writes an htpasswd-style "user:bcryptHash" file for user/pass
+// and returns its path.
+func writeHtpasswd(t *testing.T, user, pass string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	if err := os.WriteFile(path, []byte(user+":"+string(hash)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func basicHeaderValue(user, pass string) string {
+	return base64.StdEncoding.EncodeToString([]byte(user + ":" + pass))
+}
+
+// TestBasicAuthRoundTrip checks that NewBasicAuth authenticates the exact
+// credentials it was loaded with, rejects a wrong password and an unknown
+// user, and renders its Challenge for the configured realm.
+func TestBasicAuthRoundTrip(t *testing.T) {
+	path := writeHtpasswd(t, "alice", "correct-horse")
+
+	auth, err := NewBasicAuth("test-realm", path)
+	if err != nil {
+		t.Fatalf("NewBasicAuth: %v", err)
+	}
+
+	req := func(user, pass string) *http.Request {
+		r := &http.Request{Header: http.Header{}}
+		r.Header.Set("Proxy-Authorization", "Basic "+basicHeaderValue(user, pass))
+		return r
+	}
+
+	if !auth.Authenticate(req("alice", "correct-horse")) {
+		t.Fatal("Authenticate with correct credentials = false")
+	}
+	if auth.Authenticate(req("alice", "wrong-password")) {
+		t.Fatal("Authenticate with wrong password = true")
+	}
+	if auth.Authenticate(req("bob", "correct-horse")) {
+		t.Fatal("Authenticate with unknown user = true")
+	}
+	if auth.Authenticate(&http.Request{Header: http.Header{}}) {
+		t.Fatal("Authenticate with no Proxy-Authorization header = true")
+	}
+
+	if want := `Basic realm="test-realm"`; auth.Challenge() != want {
+		t.Fatalf("Challenge = %q, want %q", auth.Challenge(), want)
+	}
+}
+
+// TestNewBasicAuthMalformedLine checks that a htpasswd line without a ":"
+// separator is reported as an error rather than silently skipped.
+func TestNewBasicAuthMalformedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	if err := os.WriteFile(path, []byte("not-a-valid-line\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewBasicAuth("test-realm", path); err == nil {
+		t.Fatal("NewBasicAuth with a malformed line should have failed")
+	}
+}
+
+// TestNewBasicAuthMissingFile checks the error path for a htpasswd path that
+// doesn't exist.
+func TestNewBasicAuthMissingFile(t *testing.T) {
+	if _, err := NewBasicAuth("test-realm", filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("NewBasicAuth with a missing file should have failed")
+	}
+}
@@ -0,0 +1,129 @@
+// Package server implements the server side of HTTP CONNECT tunnelling:
+// an http.Handler that hijacks CONNECT requests, dials the target through a
+// pluggable Dialer and splices the two connections together. Composed with
+// github.com/fopina/net-proxy-httpconnect/httpconnect as the Dialer, it can
+// be chained to build multi-hop CONNECT proxies.
+package server
+
+import (
+	"io"
+	"log"
+	"net"
+	"net/http"
+)
+
+// A Dialer dials the target address for a CONNECT request. *net.Dialer,
+// *httpconnect.Dialer and golang.org/x/net/proxy.Dialer all satisfy this
+// interface.
+type Dialer interface {
+	Dial(network, address string) (net.Conn, error)
+}
+
+// Server is an http.Handler that serves HTTP CONNECT requests.
+type Server struct {
+	// Dialer is used to reach the target named by each CONNECT request.
+	// If nil, net.Dial is used.
+	Dialer Dialer
+
+	// Authenticator validates the Proxy-Authorization header of incoming
+	// requests. If nil, all requests are allowed.
+	Authenticator Authenticator
+
+	// HiddenDomain, if set, restricts 407 challenges to CONNECT requests
+	// whose Host matches it. Unauthenticated requests for any other host
+	// get a generic 404 response, indistinguishable from a server that
+	// isn't a proxy at all, instead of a tell-tale 407.
+	HiddenDomain string
+
+	// ErrorLog, if non-nil, is used to log errors that occur while serving
+	// a connection. If nil, logging is done via the log package's
+	// standard logger.
+	ErrorLog *log.Logger
+}
+
+// ListenAndServe listens on addr and serves CONNECT requests using srv.
+func ListenAndServe(addr string, srv *Server) error {
+	return http.ListenAndServe(addr, srv)
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+func (s *Server) dial(network, address string) (net.Conn, error) {
+	if s.Dialer != nil {
+		return s.Dialer.Dial(network, address)
+	}
+	return net.Dial(network, address)
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.Authenticator != nil && !s.Authenticator.Authenticate(r) {
+		if s.HiddenDomain == "" || r.Host == s.HiddenDomain {
+			w.Header().Set("Proxy-Authenticate", s.Authenticator.Challenge())
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		// Don't reveal that this is a proxy to probers hitting any other host.
+		http.NotFound(w, r)
+		return
+	}
+
+	target, err := s.dial("tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer target.Close()
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+	client, _, err := hj.Hijack()
+	if err != nil {
+		s.logf("httpconnect/server: hijack %s: %v", r.Host, err)
+		return
+	}
+	defer client.Close()
+
+	if _, err := client.Write([]byte("HTTP/1.1 200 OK\r\n\r\n")); err != nil {
+		s.logf("httpconnect/server: write connect response to %s: %v", r.Host, err)
+		return
+	}
+
+	splice(client, target, s.logf)
+}
+
+// splice copies data in both directions between a and b until either side
+// closes or errors, then returns once both copies have finished. Closing
+// dst as soon as its copy ends (rather than waiting for both) unblocks the
+// other direction's Read immediately instead of leaking it: otherwise a
+// client that hangs up while the target stays open, or vice versa, would
+// pin one of these goroutines and its connection open forever.
+func splice(a, b net.Conn, logf func(format string, args ...interface{})) {
+	done := make(chan struct{}, 2)
+	cp := func(dst, src net.Conn) {
+		_, err := io.Copy(dst, src)
+		dst.Close()
+		if err != nil {
+			logf("httpconnect/server: splice: %v", err)
+		}
+		done <- struct{}{}
+	}
+	go cp(a, b)
+	go cp(b, a)
+	<-done
+	<-done
+}
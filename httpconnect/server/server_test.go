@@ -0,0 +1,161 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// failAuth rejects every request.
+type failAuth struct{}
+
+func (failAuth) Authenticate(*http.Request) bool { return false }
+func (failAuth) Challenge() string               { return `Basic realm="test"` }
+
+// TestServeHTTPNonHijackable covers the two branches that never reach a
+// real connection: rejecting non-CONNECT methods, and bailing out when the
+// ResponseWriter can't be hijacked (httptest.NewRecorder doesn't implement
+// http.Hijacker). The second case needs a Dialer that succeeds, since the
+// hijack check only runs after the target has been dialed.
+func TestServeHTTPNonHijackable(t *testing.T) {
+	fakeTarget, _ := net.Pipe()
+	succeedingDialer := dialerFunc(func(string, string) (net.Conn, error) { return fakeTarget, nil })
+
+	tests := []struct {
+		name       string
+		srv        *Server
+		method     string
+		wantStatus int
+	}{
+		{"non-CONNECT method rejected", &Server{}, http.MethodGet, http.StatusMethodNotAllowed},
+		{"CONNECT without a hijackable ResponseWriter", &Server{Dialer: succeedingDialer}, http.MethodConnect, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://example.com/", nil)
+			req.Host = "example.com:443"
+			rec := httptest.NewRecorder()
+
+			tt.srv.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// startServer starts srv on a loopback listener and returns its address.
+func startServer(t *testing.T, srv *Server) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := &http.Server{Handler: srv}
+	go hs.Serve(ln)
+	t.Cleanup(func() { hs.Close() })
+	return ln.Addr().String()
+}
+
+func rawConnect(t *testing.T, proxyAddr, host string) (net.Conn, string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", proxyAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(conn, "CONNECT "+host+" HTTP/1.1\r\nHost: "+host+"\r\n\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	buf := make([]byte, 512)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, string(buf[:n])
+}
+
+// TestServeHTTPHiddenDomain checks that an unauthenticated CONNECT for the
+// hidden domain gets a tell-tale 407, while any other host gets a generic
+// 404 indistinguishable from a non-proxy server.
+func TestServeHTTPHiddenDomain(t *testing.T) {
+	addr := startServer(t, &Server{Authenticator: failAuth{}, HiddenDomain: "secret.internal:443"})
+
+	conn, resp := rawConnect(t, addr, "secret.internal:443")
+	conn.Close()
+	if want := "407"; !hasStatus(resp, want) {
+		t.Fatalf("CONNECT to hidden domain without auth = %q, want status %s", resp, want)
+	}
+
+	conn, resp = rawConnect(t, addr, "other.example:443")
+	conn.Close()
+	if want := "404"; !hasStatus(resp, want) {
+		t.Fatalf("CONNECT to non-hidden domain without auth = %q, want status %s", resp, want)
+	}
+}
+
+// TestServeHTTPDialFailure checks that a target dial error surfaces as 502.
+func TestServeHTTPDialFailure(t *testing.T) {
+	addr := startServer(t, &Server{Dialer: dialerFunc(func(string, string) (net.Conn, error) {
+		return nil, errors.New("boom")
+	})})
+
+	conn, resp := rawConnect(t, addr, "example.com:443")
+	defer conn.Close()
+	if want := "502"; !hasStatus(resp, want) {
+		t.Fatalf("CONNECT with failing dialer = %q, want status %s", resp, want)
+	}
+}
+
+// TestServeHTTPConnectSucceeds checks the full round trip: CONNECT gets a
+// 200, and bytes flow through the spliced tunnel to the dialed target.
+func TestServeHTTPConnectSucceeds(t *testing.T) {
+	targetLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer targetLn.Close()
+	go func() {
+		c, err := targetLn.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		io.Copy(c, c)
+	}()
+
+	addr := startServer(t, &Server{})
+
+	conn, resp := rawConnect(t, addr, targetLn.Addr().String())
+	defer conn.Close()
+	if !hasStatus(resp, "200") {
+		t.Fatalf("CONNECT = %q, want status 200", resp)
+	}
+
+	msg := []byte("hello through the tunnel")
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(buf) != string(msg) {
+		t.Fatalf("echo = %q, want %q", buf, msg)
+	}
+}
+
+type dialerFunc func(network, address string) (net.Conn, error)
+
+func (f dialerFunc) Dial(network, address string) (net.Conn, error) { return f(network, address) }
+
+func hasStatus(resp, status string) bool {
+	want := "HTTP/1.1 " + status
+	return len(resp) >= len(want) && resp[:len(want)] == want
+}
@@ -0,0 +1,24 @@
+package proxy
+
+import (
+	"errors"
+	"net/url"
+
+	"golang.org/x/net/proxy"
+)
+
+// NewFromURL returns a Dialer for u, dispatching on scheme: "http"/"https"
+// tunnel via HTTP CONNECT (see HTTPCONNECT), "socks5"/"socks5h" use
+// golang.org/x/net/proxy, and "ssh" opens an SSH client connection and
+// dials through it. forward, if non-nil, is used to reach the proxy itself.
+func NewFromURL(u *url.URL, forward proxy.Dialer) (proxy.Dialer, error) {
+	switch u.Scheme {
+	case "http", "https":
+		return HTTPCONNECT(u, forward)
+	case "socks5", "socks5h":
+		return proxy.FromURL(u, forward)
+	case "ssh":
+		return sshDialer(u, forward)
+	}
+	return nil, errors.New("proxy: unsupported scheme: " + u.Scheme)
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestNewFromURLDispatch checks that NewFromURL routes each supported
+// scheme to a non-nil Dialer without error, and rejects an unknown scheme
+// with this package's lowercase, prefixed error convention.
+func TestNewFromURLDispatch(t *testing.T) {
+	tests := []struct {
+		rawURL  string
+		wantErr bool
+	}{
+		{"http://proxy.example:8080", false},
+		{"https://proxy.example:8443", false},
+		{"socks5://proxy.example:1080", false},
+		{"socks5h://proxy.example:1080", false},
+		{"ssh://user@proxy.example:22?insecure=1", false},
+		{"ftp://proxy.example:21", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rawURL, func(t *testing.T) {
+			u, err := url.Parse(tt.rawURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			d, err := NewFromURL(u, nil)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("NewFromURL should have failed for an unsupported scheme")
+				}
+				if !strings.HasPrefix(err.Error(), "proxy: unsupported scheme: ") {
+					t.Fatalf("error = %q, want the proxy: unsupported scheme: prefix", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewFromURL: %v", err)
+			}
+			if d == nil {
+				t.Fatal("NewFromURL returned a nil Dialer with no error")
+			}
+		})
+	}
+}
+
+// recordingForward is a golang.org/x/net/proxy.Dialer that records the address it was
+// asked to dial, so a test can confirm a forward Dialer actually gets used
+// to reach the proxy rather than being silently dropped.
+type recordingForward struct {
+	dialed string
+}
+
+func (f *recordingForward) Dial(network, address string) (net.Conn, error) {
+	f.dialed = address
+	return nil, errors.New("recordingForward: refusing to actually dial")
+}
+
+// TestNewFromURLForwardsDialer checks that a non-nil forward Dialer is
+// threaded through to the socks5 case, which golang.org/x/net/proxy builds
+// directly from the arguments we pass it: dialing through the resulting
+// Dialer should reach the proxy address via forward, not net.Dial directly.
+func TestNewFromURLForwardsDialer(t *testing.T) {
+	u, err := url.Parse("socks5://proxy.example:1080")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forward := &recordingForward{}
+	d, err := NewFromURL(u, forward)
+	if err != nil {
+		t.Fatalf("NewFromURL: %v", err)
+	}
+
+	d.Dial("tcp", "target.example:443")
+
+	if forward.dialed != "proxy.example:1080" {
+		t.Fatalf("forward Dialer saw address %q, want the proxy address %q (forward Dialer not used)", forward.dialed, "proxy.example:1080")
+	}
+}
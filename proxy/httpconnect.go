@@ -12,14 +12,31 @@ import (
 
 // HTTPCONNECT returns a Dialer that makes HTTP CONNECT connections to the given address
 func HTTPCONNECT(url *url.URL, forward proxy.Dialer) (proxy.Dialer, error) {
-	transport := http.DefaultTransport.(*http.Transport)
+	if url.Scheme != "http" && url.Scheme != "https" {
+		return nil, errors.New("Unsupported scheme: " + url.Scheme)
+	}
+
+	// Clone rather than mutate http.DefaultTransport: it's the shared
+	// singleton every other http.Client in the process falls back to, and
+	// NewDialer also sets ProxyConnectHeader on whatever transport it's
+	// given for the proxy's own credentials.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
 	if forward != nil {
 		transport.Dial = forward.Dial
 	}
 
-	if url.Scheme != "http" && url.Scheme != "https" {
-		return nil, errors.New("Unsupported scheme: " + url.Scheme)
-	}
 	d := httpconnect.NewDialer("tcp", url, transport)
 	return d, nil
 }
+
+// HTTPCONNECTChain returns a Dialer that tunnels through each of urls in
+// order, CONNECTing to the next hop over the previous one, before reaching
+// the final destination. It mirrors HTTPCONNECT but for multi-hop chains.
+func HTTPCONNECTChain(urls []*url.URL, forward proxy.Dialer) (proxy.Dialer, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if forward != nil {
+		transport.Dial = forward.Dial
+	}
+
+	return httpconnect.NewChainDialer("tcp", urls, transport)
+}
@@ -2,10 +2,13 @@ package proxy
 
 import "golang.org/x/net/proxy"
 
-// RegisterSchemes registers HTTPCONNECT dialer as proxy scheme handler for HTTP and HTTPS schemes
+// RegisterSchemes registers HTTPCONNECT and the ssh Dialer as proxy scheme
+// handlers for the http, https and ssh schemes. socks5/socks5h need no
+// registration: golang.org/x/net/proxy already handles them natively.
 func RegisterSchemes() {
 	// init() would be a good place to put this, but module might never be imported
 	// such as code simply calling `golang.org/x/net/proxy.FromEnvironment()`
 	proxy.RegisterDialerType("http", HTTPCONNECT)
 	proxy.RegisterDialerType("https", HTTPCONNECT)
+	proxy.RegisterDialerType("ssh", sshDialer)
 }
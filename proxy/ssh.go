@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/net/proxy"
+)
+
+// sshDialer returns a Dialer that, on first use, opens an SSH client
+// connection to u (through forward, or directly if forward is nil) and
+// tunnels subsequent Dial calls through it as a jump host, the same way an
+// HTTP CONNECT or SOCKS5 Dialer would. The connection is established lazily
+// so that constructing the Dialer (e.g. via RegisterDialerType) never dials
+// out on its own.
+//
+// Authentication uses the private key named by the "key" query parameter
+// (ssh://user@host?key=/path/to/key), falling back to a running ssh-agent
+// (SSH_AUTH_SOCK) when no key is given. The host key is checked against
+// "known_hosts" (or ~/.ssh/known_hosts by default); pass ?insecure=1 to skip
+// verification.
+func sshDialer(u *url.URL, forward proxy.Dialer) (proxy.Dialer, error) {
+	user := "root"
+	if u.User != nil {
+		user = u.User.Username()
+	}
+	port := u.Port()
+	if port == "" {
+		port = "22"
+	}
+
+	hostKeyCallback, err := sshHostKeyCallback(u)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sshClientDialer{
+		user:            user,
+		addr:            net.JoinHostPort(u.Hostname(), port),
+		keyPath:         u.Query().Get("key"),
+		hostKeyCallback: hostKeyCallback,
+		forward:         forward,
+	}, nil
+}
+
+// sshClientDialer adapts an *ssh.Client to proxy.Dialer so it can be used
+// anywhere a Dialer is expected, as a jump-host proxy. The client is
+// established on first Dial and reused for subsequent ones.
+type sshClientDialer struct {
+	user            string
+	addr            string
+	keyPath         string
+	hostKeyCallback ssh.HostKeyCallback
+	forward         proxy.Dialer
+
+	once   sync.Once
+	client *ssh.Client
+	err    error
+}
+
+func (s *sshClientDialer) Dial(network, address string) (net.Conn, error) {
+	s.once.Do(s.connect)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.client.Dial(network, address)
+}
+
+func (s *sshClientDialer) connect() {
+	auth, agentConn, err := sshAuthMethod(s.keyPath)
+	if err != nil {
+		s.err = err
+		return
+	}
+	if agentConn != nil {
+		// Signers returned by agent.Client call back into agentConn at
+		// Sign time, not just when listed, so it must stay open for the
+		// whole handshake below, not just long enough to list signers.
+		defer agentConn.Close()
+	}
+
+	forward := s.forward
+	if forward == nil {
+		forward = proxy.Direct
+	}
+	conn, err := forward.Dial("tcp", s.addr)
+	if err != nil {
+		s.err = err
+		return
+	}
+
+	config := &ssh.ClientConfig{
+		User:            s.user,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: s.hostKeyCallback,
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, s.addr, config)
+	if err != nil {
+		conn.Close()
+		s.err = err
+		return
+	}
+	s.client = ssh.NewClient(sshConn, chans, reqs)
+}
+
+// sshHostKeyCallback returns the HostKeyCallback to use for u: InsecureIgnoreHostKey
+// if ?insecure=1 is set, otherwise a known_hosts-backed callback reading the
+// "known_hosts" query parameter or ~/.ssh/known_hosts.
+func sshHostKeyCallback(u *url.URL) (ssh.HostKeyCallback, error) {
+	if insecure, _ := strconv.ParseBool(u.Query().Get("insecure")); insecure {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	path := u.Query().Get("known_hosts")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("proxy: locating known_hosts: %w", err)
+		}
+		path = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	cb, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("proxy: loading known_hosts (pass ?insecure=1 to skip host key verification): %w", err)
+	}
+	return cb, nil
+}
+
+// sshAuthMethod returns key-based auth from keyPath if set, otherwise falls
+// back to a running ssh-agent (SSH_AUTH_SOCK). For the agent case it also
+// returns the agent's net.Conn: the ssh.AuthMethod calls back into it at
+// Sign time (during the handshake), not just to list signers here, so the
+// caller must keep it open until the handshake finishes.
+func sshAuthMethod(keyPath string) (method ssh.AuthMethod, agentConn net.Conn, err error) {
+	if keyPath != "" {
+		key, err := os.ReadFile(keyPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		return ssh.PublicKeys(signer), nil, nil
+	}
+
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, nil, errors.New("proxy: ssh scheme requires ?key=/path/to/key or a running ssh-agent (SSH_AUTH_SOCK)")
+	}
+	agentConn, err = net.Dial("unix", sock)
+	if err != nil {
+		return nil, nil, fmt.Errorf("proxy: connecting to ssh-agent: %w", err)
+	}
+	return ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers), agentConn, nil
+}
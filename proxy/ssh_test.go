@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// writeTestKey generates an ed25519 private key, PEM-encodes it and writes
+// it to a file under t.TempDir, returning the path.
+func writeTestKey(t *testing.T) string {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestSSHAuthMethodKey checks the ?key= path: a valid private key file
+// yields a public-key AuthMethod and no agent connection to keep open.
+func TestSSHAuthMethodKey(t *testing.T) {
+	keyPath := writeTestKey(t)
+
+	method, agentConn, err := sshAuthMethod(keyPath)
+	if err != nil {
+		t.Fatalf("sshAuthMethod: %v", err)
+	}
+	if method == nil {
+		t.Fatal("sshAuthMethod returned a nil AuthMethod")
+	}
+	if agentConn != nil {
+		t.Fatal("sshAuthMethod with a key path should not open an agent connection")
+	}
+}
+
+// TestSSHAuthMethodKeyMissingFile checks that a non-existent key path is
+// reported as an error rather than silently falling back to the agent.
+func TestSSHAuthMethodKeyMissingFile(t *testing.T) {
+	_, _, err := sshAuthMethod(filepath.Join(t.TempDir(), "missing"))
+	if err == nil {
+		t.Fatal("sshAuthMethod with a missing key file should have failed")
+	}
+}
+
+// TestSSHAuthMethodKeyNotAKey checks the parse-error path for a file that
+// exists but isn't a valid private key.
+func TestSSHAuthMethodKeyNotAKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not-a-key")
+	if err := os.WriteFile(path, []byte("not a private key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err := sshAuthMethod(path)
+	if err == nil {
+		t.Fatal("sshAuthMethod with an invalid key file should have failed")
+	}
+}
+
+// TestSSHAuthMethodAgentNoSocket checks the no-key, no-agent case: with
+// SSH_AUTH_SOCK unset (and no key path given), sshAuthMethod should return a
+// clean error rather than hanging or panicking.
+func TestSSHAuthMethodAgentNoSocket(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	_, _, err := sshAuthMethod("")
+	if err == nil {
+		t.Fatal("sshAuthMethod with no key and no SSH_AUTH_SOCK should have failed")
+	}
+}
+
+// TestSSHAuthMethodAgent checks the fallback path: with SSH_AUTH_SOCK
+// pointing at a live listener, sshAuthMethod dials it and returns the
+// agent's net.Conn alongside the AuthMethod, leaving it open for the caller
+// to close once the handshake finishes.
+func TestSSHAuthMethodAgent(t *testing.T) {
+	dir := t.TempDir()
+	sock := filepath.Join(dir, "agent.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	method, agentConn, err := sshAuthMethod("")
+	if err != nil {
+		t.Fatalf("sshAuthMethod: %v", err)
+	}
+	if method == nil {
+		t.Fatal("sshAuthMethod returned a nil AuthMethod")
+	}
+	if agentConn == nil {
+		t.Fatal("sshAuthMethod with a running agent should return its net.Conn")
+	}
+	agentConn.Close()
+}